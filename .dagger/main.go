@@ -4,6 +4,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"dagger/vibe-workspace/internal/dagger"
 	"golang.org/x/sync/errgroup"
@@ -12,16 +13,28 @@ import (
 // VibeWorkspace is the main Dagger module for the vibe-workspace project
 type VibeWorkspace struct{}
 
+// Pinned mold release used to accelerate Linux linking (see withAcceleration).
+const (
+	moldVersion    = "2.34.0"
+	moldReleaseURL = "https://github.com/rui314/mold/releases/download/v" + moldVersion + "/mold-" + moldVersion + "-x86_64-linux.tar.gz"
+)
+
 // Format checks if the Rust code is properly formatted
-func (m *VibeWorkspace) Format(ctx context.Context, source *dagger.Directory) *dagger.Container {
-	return m.rustBase(source).
-		WithExec([]string{"cargo", "fmt", "--check"})
+func (m *VibeWorkspace) Format(ctx context.Context, source *dagger.Directory) (*dagger.Container, error) {
+	a, err := NewBuilder(m, source).runStep(ctx, FormatStep{})
+	if err != nil {
+		return nil, err
+	}
+	return a.Container, nil
 }
 
 // Lint runs clippy to check for code quality issues
-func (m *VibeWorkspace) Lint(ctx context.Context, source *dagger.Directory) *dagger.Container {
-	return m.buildEnv(source).
-		WithExec([]string{"cargo", "clippy", "--all-targets", "--all-features"})
+func (m *VibeWorkspace) Lint(ctx context.Context, source *dagger.Directory) (*dagger.Container, error) {
+	a, err := NewBuilder(m, source).runStep(ctx, LintStep{})
+	if err != nil {
+		return nil, err
+	}
+	return a.Container, nil
 }
 
 // Test runs the test suite for a specific platform
@@ -31,17 +44,31 @@ func (m *VibeWorkspace) Test(
 	// +optional
 	// +default="linux/amd64"
 	platform string,
-) *dagger.Container {
-	return m.buildEnvWithPlatform(source, platform).
-		WithExec([]string{"cargo", "test"})
+	// +optional
+	// +default=true
+	useMold bool,
+	// +optional
+	// +default=true
+	useSccache bool,
+) (*dagger.Container, error) {
+	step := TestStep{Platform: platform, UseMold: useMold, UseSccache: useSccache}
+	a, err := NewBuilder(m, source).runStep(ctx, step)
+	if err != nil {
+		return nil, err
+	}
+	return a.Container, nil
 }
 
 // Coverage generates a code coverage report
-func (m *VibeWorkspace) Coverage(ctx context.Context, source *dagger.Directory) *dagger.File {
-	return m.buildEnv(source).
+func (m *VibeWorkspace) Coverage(ctx context.Context, source *dagger.Directory) (*dagger.File, error) {
+	ctr, err := m.buildEnv(ctx, source, "debug", true, true)
+	if err != nil {
+		return nil, err
+	}
+	return ctr.
 		WithExec([]string{"cargo", "install", "cargo-tarpaulin"}).
 		WithExec([]string{"cargo", "tarpaulin", "--out", "Html", "--output-dir", "."}).
-		File("tarpaulin-report.html")
+		File("tarpaulin-report.html"), nil
 }
 
 // Build creates a debug build for a specific platform
@@ -51,18 +78,19 @@ func (m *VibeWorkspace) Build(
 	// +optional
 	// +default="linux/amd64"
 	platform string,
-) *dagger.File {
-	base := m.buildEnvWithPlatform(source, platform)
-	name := "vibe"
-	
-	// Build the binary
-	container := base.
-		WithExec([]string{"cargo", "build", "--bin", name})
-	
-	// The binary path in the container
-	path := fmt.Sprintf("/src/target/debug/%s", name)
-	
-	return container.File(path)
+	// +optional
+	// +default=true
+	useMold bool,
+	// +optional
+	// +default=true
+	useSccache bool,
+) (*dagger.File, error) {
+	step := BuildStep{Profile: "debug", Platform: platform, UseMold: useMold, UseSccache: useSccache}
+	a, err := NewBuilder(m, source).runStep(ctx, step)
+	if err != nil {
+		return nil, err
+	}
+	return a.File, nil
 }
 
 // BuildDebug creates a debug build and shows the build output
@@ -73,28 +101,31 @@ func (m *VibeWorkspace) BuildDebug(
 	// +default="linux/amd64"
 	platform string,
 ) (string, error) {
-	base := m.buildEnvWithPlatform(source, platform)
+	base, err := m.buildEnvWithPlatform(ctx, source, platform, "debug", false, false)
+	if err != nil {
+		return "", err
+	}
 	name := "vibe"
-	
+
 	// Build the binary and capture output
 	container := base.
 		WithExec([]string{"cargo", "build", "--bin", name})
-	
+
 	// Get the build output
 	output, err := container.Stdout(ctx)
 	if err != nil {
 		return "", fmt.Errorf("build failed: %w", err)
 	}
-	
+
 	// Also check if the binary exists
 	checkContainer := container.
 		WithExec([]string{"ls", "-la", "/src/target/debug/"})
-	
+
 	lsOutput, err := checkContainer.Stdout(ctx)
 	if err != nil {
 		return output, fmt.Errorf("failed to list directory: %w", err)
 	}
-	
+
 	return fmt.Sprintf("Build output:\n%s\n\nDirectory listing:\n%s", output, lsOutput), nil
 }
 
@@ -105,22 +136,36 @@ func (m *VibeWorkspace) BuildRelease(
 	// +optional
 	// +default="linux/amd64"
 	platform string,
-) *dagger.File {
-	base := m.buildEnvWithPlatform(source, platform)
-	name := "vibe"
-	path := fmt.Sprintf("/src/target/release/%s", name)
-
-	return base.
-		WithExec([]string{"cargo", "build", "--release", "--bin", name}).
-		File(path)
+	// +optional
+	// +default=true
+	useMold bool,
+	// +optional
+	// +default=true
+	useSccache bool,
+) (*dagger.File, error) {
+	step := BuildStep{Profile: "release", Platform: platform, UseMold: useMold, UseSccache: useSccache}
+	a, err := NewBuilder(m, source).runStep(ctx, step)
+	if err != nil {
+		return nil, err
+	}
+	return a.File, nil
 }
 
 // CI runs the complete CI pipeline (format, lint, test)
-func (m *VibeWorkspace) CI(ctx context.Context, source *dagger.Directory) *dagger.Container {
-	return m.rustBase(source).
-		WithExec([]string{"cargo", "fmt", "--check"}).
-		WithExec([]string{"cargo", "clippy", "--all-targets", "--all-features"}).
-		WithExec([]string{"cargo", "test"})
+func (m *VibeWorkspace) CI(ctx context.Context, source *dagger.Directory) (*dagger.Container, error) {
+	b := NewBuilder(m, source)
+
+	if _, err := b.runStep(ctx, FormatStep{}); err != nil {
+		return nil, err
+	}
+	if _, err := b.runStep(ctx, LintStep{}); err != nil {
+		return nil, err
+	}
+	a, err := b.runStep(ctx, TestStep{Platform: "linux/amd64", UseMold: true, UseSccache: true})
+	if err != nil {
+		return nil, err
+	}
+	return a.Container, nil
 }
 
 // Package creates a release archive for a specific platform
@@ -132,7 +177,7 @@ func (m *VibeWorkspace) Package(
 	version string,
 ) *dagger.File {
 	archiveName := fmt.Sprintf("vibe-workspace-%s-%s.tar.gz", version, platform)
-	
+
 	return dag.Container().
 		From("alpine:latest").
 		WithExec([]string{"apk", "add", "--no-cache", "tar", "gzip"}).
@@ -150,29 +195,13 @@ func (m *VibeWorkspace) Release(
 	// +optional
 	// +default="v0.1.0"
 	version string,
-) *dagger.Directory {
-	var archives []*dagger.File
-
-	// Build for Linux x86_64
-	linuxAmd64Binary := m.BuildRelease(ctx, source, "linux/amd64")
-	linuxAmd64Archive := m.Package(ctx, source, linuxAmd64Binary, "x86_64-unknown-linux-gnu", version)
-	archives = append(archives, linuxAmd64Archive)
-
-	// Build for Linux ARM64
-	linuxArm64Binary := m.BuildRelease(ctx, source, "linux/arm64")
-	linuxArm64Archive := m.Package(ctx, source, linuxArm64Binary, "aarch64-unknown-linux-gnu", version)
-	archives = append(archives, linuxArm64Archive)
-
-	// Create output directory with all archives
-	output := dag.Directory()
-	
-	// Add Linux x86_64 archive
-	output = output.WithFile(fmt.Sprintf("vibe-workspace-%s-x86_64-unknown-linux-gnu.tar.gz", version), archives[0])
-	
-	// Add Linux ARM64 archive
-	output = output.WithFile(fmt.Sprintf("vibe-workspace-%s-aarch64-unknown-linux-gnu.tar.gz", version), archives[1])
-
-	return output
+) (*dagger.Directory, error) {
+	step := ReleaseStep{Targets: defaultReleaseTargets(), Version: version}
+	a, err := NewBuilder(m, source).runStep(ctx, step)
+	if err != nil {
+		return nil, err
+	}
+	return m.addReleaseMetadata(ctx, source, a.Directory)
 }
 
 // ZigbuildSingle builds a release binary for a single platform using cargo-zigbuild
@@ -180,36 +209,31 @@ func (m *VibeWorkspace) ZigbuildSingle(
 	ctx context.Context,
 	source *dagger.Directory,
 	target string,
-) *dagger.File {
-	base := m.zigbuildBase(source)
-	
-	// Add the target
-	base = base.WithExec([]string{"rustup", "target", "add", target})
-	
-	// Determine features based on target
-	var buildCmd []string
-	if contains(target, "apple-darwin") {
-		// macOS targets might have specific features in the future
-		buildCmd = []string{"cargo", "zigbuild", "--release", "--target", target}
-	} else if contains(target, "windows") {
-		// Windows targets
-		buildCmd = []string{"cargo", "zigbuild", "--release", "--target", target}
-	} else {
-		// Linux and other targets
-		buildCmd = []string{"cargo", "zigbuild", "--release", "--target", target}
+	// +optional
+	// +default=true
+	useMold bool,
+	// +optional
+	// +default=true
+	useSccache bool,
+) (*dagger.File, error) {
+	base, err := m.zigbuildBase(ctx, source, target, useMold, useSccache)
+	if err != nil {
+		return nil, err
 	}
-	
+
+	t := m.targetFor(target)
+
+	// The rustup target and its extra components are already installed by zigbuildBase,
+	// before warmDependencyCache's skeleton build needed them. zigbuildBase also sets
+	// RUSTFLAGS (combined with the mold linker flag rather than overwriting it), but only
+	// after that skeleton build, so the skeleton build runs without them.
+
 	// Build the binary
-	container := base.WithExec(buildCmd)
-	
-	// Determine binary path
-	binaryName := "vibe"
-	if contains(target, "windows") {
-		binaryName = "vibe.exe"
-	}
-	binaryPath := fmt.Sprintf("target/%s/release/%s", target, binaryName)
-	
-	return container.File(binaryPath)
+	container := base.WithExec([]string{"cargo", "zigbuild", "--release", "--target", target})
+
+	binaryPath := fmt.Sprintf("target/%s/release/vibe%s", target, t.BinSuffix)
+
+	return container.File(binaryPath), nil
 }
 
 // ReleaseZigbuild builds release binaries for multiple platforms using cargo-zigbuild
@@ -220,18 +244,71 @@ func (m *VibeWorkspace) ReleaseZigbuild(
 	// +default="v0.1.0"
 	version string,
 ) (*dagger.Directory, error) {
-	// Define all target platforms
-	targets := []struct {
-		rust     string
-		platform string
-		archive  string
-	}{
-		{"x86_64-unknown-linux-gnu", "linux/amd64", "tar.gz"},
-		{"x86_64-apple-darwin", "darwin/amd64", "tar.gz"},
-		{"aarch64-apple-darwin", "darwin/arm64", "tar.gz"},
-		{"universal2-apple-darwin", "darwin/universal", "tar.gz"},
+	archives, archiveNames, err := m.buildZigbuildArchives(ctx, source, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create output directory with all archives
+	output := dag.Directory()
+	for i, archive := range archives {
+		if archive != nil {
+			output = output.WithFile(archiveNames[i], archive)
+		}
 	}
 
+	return m.addReleaseMetadata(ctx, source, output)
+}
+
+// Target describes one cross-compilation target: the Rust triple to build, the Dagger
+// platform it's labeled with, the archive format its release ships in, the suffix cargo
+// appends to the binary name (".exe" on Windows), any extra RUSTFLAGS it needs (e.g. musl's
+// static CRT), and any extra rustup components ZigbuildSingle must install first.
+type Target struct {
+	Rust       string
+	Platform   string
+	Archive    string
+	BinSuffix  string
+	RustFlags  []string
+	ExtraSetup []string
+}
+
+// Targets returns the full cross-compilation matrix cargo-zigbuild supports here, so
+// callers can enumerate supported build targets from the Dagger CLI instead of guessing
+// at triples.
+func (m *VibeWorkspace) Targets() []Target {
+	return []Target{
+		{Rust: "x86_64-unknown-linux-gnu", Platform: "linux/amd64", Archive: "tar.gz"},
+		{Rust: "x86_64-unknown-linux-musl", Platform: "linux/amd64", Archive: "tar.gz", RustFlags: []string{"-C", "target-feature=+crt-static"}},
+		{Rust: "aarch64-unknown-linux-musl", Platform: "linux/arm64", Archive: "tar.gz", RustFlags: []string{"-C", "target-feature=+crt-static"}},
+		{Rust: "x86_64-apple-darwin", Platform: "darwin/amd64", Archive: "tar.gz"},
+		{Rust: "aarch64-apple-darwin", Platform: "darwin/arm64", Archive: "tar.gz"},
+		{Rust: "universal2-apple-darwin", Platform: "darwin/universal", Archive: "tar.gz"},
+		{Rust: "x86_64-pc-windows-gnu", Platform: "windows/amd64", Archive: "zip", BinSuffix: ".exe"},
+		{Rust: "aarch64-pc-windows-gnullvm", Platform: "windows/arm64", Archive: "zip", BinSuffix: ".exe", ExtraSetup: []string{"llvm-tools-preview"}},
+	}
+}
+
+// targetFor looks up the Target metadata for a Rust triple, falling back to a bare entry
+// for triples outside the matrix returned by Targets().
+func (m *VibeWorkspace) targetFor(rust string) Target {
+	for _, t := range m.Targets() {
+		if t.Rust == rust {
+			return t
+		}
+	}
+	return Target{Rust: rust, Archive: "tar.gz"}
+}
+
+// buildZigbuildArchives builds and packages every Target in parallel, returning the
+// archive files alongside the archive name each one should be published under.
+func (m *VibeWorkspace) buildZigbuildArchives(
+	ctx context.Context,
+	source *dagger.Directory,
+	version string,
+) ([]*dagger.File, []string, error) {
+	targets := m.Targets()
+
 	// Build all targets in parallel
 	g, gctx := errgroup.WithContext(ctx)
 	archives := make([]*dagger.File, len(targets))
@@ -241,37 +318,213 @@ func (m *VibeWorkspace) ReleaseZigbuild(
 		i, target := i, target // capture loop variables
 		g.Go(func() error {
 			// Build the binary
-			binary := m.ZigbuildSingle(gctx, source, target.rust)
-			
+			binary, err := m.ZigbuildSingle(gctx, source, target.Rust, true, true)
+			if err != nil {
+				return err
+			}
+
 			// Package the binary and determine archive name
-			if target.archive == "zip" {
-				archives[i] = m.packageZip(gctx, source, binary, target.rust, version)
-				archiveNames[i] = fmt.Sprintf("vibe-workspace-%s-%s.zip", version, target.rust)
+			if target.Archive == "zip" {
+				archives[i] = m.packageZip(gctx, source, binary, target.Rust, version)
+				archiveNames[i] = fmt.Sprintf("vibe-workspace-%s-%s.zip", version, target.Rust)
 			} else {
-				archives[i] = m.packageTarGz(gctx, source, binary, target.rust, version)
-				archiveNames[i] = fmt.Sprintf("vibe-workspace-%s-%s.tar.gz", version, target.rust)
+				archives[i] = m.packageTarGz(gctx, source, binary, target.Rust, version)
+				archiveNames[i] = fmt.Sprintf("vibe-workspace-%s-%s.tar.gz", version, target.Rust)
 			}
-			
+
 			return nil
 		})
 	}
 
 	// Wait for all builds to complete
 	if err := g.Wait(); err != nil {
+		return nil, nil, err
+	}
+
+	return archives, archiveNames, nil
+}
+
+// ReleaseSigned builds the full cross-compiled release matrix and returns a directory
+// containing every archive, a detached cosign signature for each one, a CycloneDX SBOM,
+// and a SHA256SUMS manifest that is itself signed — the archive+checksum+signature bundle
+// go-ethereum's build/ci.go archive subcommand produces for its releases, with the signing
+// key and password supplied as Dagger secrets rather than read from the environment.
+func (m *VibeWorkspace) ReleaseSigned(
+	ctx context.Context,
+	source *dagger.Directory,
+	// +optional
+	// +default="v0.1.0"
+	version string,
+	cosignKey *dagger.Secret,
+	cosignPassword *dagger.Secret,
+) (*dagger.Directory, error) {
+	archives, archiveNames, err := m.buildZigbuildArchives(ctx, source, version)
+	if err != nil {
 		return nil, err
 	}
 
-	// Create output directory with all archives
 	output := dag.Directory()
+	sumsCtr := dag.Container().From("alpine:latest").WithWorkdir("/out")
+
 	for i, archive := range archives {
-		if archive != nil {
-			output = output.WithFile(archiveNames[i], archive)
+		if archive == nil {
+			continue
 		}
+		name := archiveNames[i]
+		output = output.
+			WithFile(name, archive).
+			WithFile(name+".sig", m.signBlob(archive, cosignKey, cosignPassword))
+		sumsCtr = sumsCtr.WithFile("/out/"+name, archive)
+	}
+
+	sums := sumsCtr.
+		WithExec([]string{"sh", "-c", "sha256sum * > SHA256SUMS"}).
+		File("SHA256SUMS")
+
+	sbom, err := m.sbom(ctx, source)
+	if err != nil {
+		return nil, err
 	}
 
+	output = output.
+		WithFile("SHA256SUMS", sums).
+		WithFile("SHA256SUMS.sig", m.signBlob(sums, cosignKey, cosignPassword)).
+		WithFile("vibe-workspace.sbom.json", sbom)
+
 	return output, nil
 }
 
+// addReleaseMetadata augments a directory of release archives with a CycloneDX SBOM and a
+// SHA256SUMS manifest covering every archive in the directory.
+func (m *VibeWorkspace) addReleaseMetadata(ctx context.Context, source *dagger.Directory, archives *dagger.Directory) (*dagger.Directory, error) {
+	names, err := archives.Entries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing release archives: %w", err)
+	}
+
+	sumsCtr := dag.Container().From("alpine:latest").WithWorkdir("/out")
+	for _, name := range names {
+		sumsCtr = sumsCtr.WithFile("/out/"+name, archives.File(name))
+	}
+	sums := sumsCtr.
+		WithExec([]string{"sh", "-c", "sha256sum * > SHA256SUMS"}).
+		File("SHA256SUMS")
+
+	sbom, err := m.sbom(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	return archives.
+		WithFile("SHA256SUMS", sums).
+		WithFile("vibe-workspace.sbom.json", sbom), nil
+}
+
+// sbom generates a CycloneDX SBOM for the Rust workspace by running cargo-cyclonedx in
+// the build container.
+func (m *VibeWorkspace) sbom(ctx context.Context, source *dagger.Directory) (*dagger.File, error) {
+	ctr, err := m.buildEnv(ctx, source, "debug", false, false)
+	if err != nil {
+		return nil, err
+	}
+	// cargo-cyclonedx writes one *.cdx.json per workspace member, and (depending on
+	// version) drops each one next to that member's own Cargo.toml rather than in the
+	// workspace root, so find them recursively instead of a root-only shell glob. Merge
+	// them into one combined document (first member's metadata, every member's
+	// components) rather than assuming there's only one to mv into place.
+	mergeScript := `find . -name '*.cdx.json' -print0 | xargs -0 jq -s '.[0] + {components: (map(.components // []) | add // [])}' > vibe-workspace.sbom.json`
+	return ctr.
+		WithExec([]string{"cargo", "install", "cargo-cyclonedx"}).
+		WithExec([]string{"cargo", "cyclonedx", "--format", "json"}).
+		WithExec([]string{"apt-get", "update"}).
+		WithExec([]string{"apt-get", "install", "-y", "--no-install-recommends", "jq"}).
+		WithExec([]string{"sh", "-c", mergeScript}).
+		File("vibe-workspace.sbom.json"), nil
+}
+
+// signBlob produces a detached cosign signature for file, reading the signing key and its
+// password from Dagger secrets so neither ever appears in plaintext in the build graph.
+func (m *VibeWorkspace) signBlob(file *dagger.File, key *dagger.Secret, password *dagger.Secret) *dagger.File {
+	return dag.Container().
+		From("gcr.io/projectsigstore/cosign:latest").
+		WithMountedSecret("/run/secrets/cosign.key", key).
+		WithSecretVariable("COSIGN_PASSWORD", password).
+		WithFile("/tmp/artifact", file).
+		WithExec([]string{
+			"cosign", "sign-blob",
+			"--key", "/run/secrets/cosign.key",
+			"--output-signature", "/tmp/artifact.sig",
+			"--yes",
+			"/tmp/artifact",
+		}).
+		File("/tmp/artifact.sig")
+}
+
+// RustSource splits a Rust workspace into a dependency-only "skeleton" — the workspace
+// and member Cargo.toml/Cargo.lock manifests, plus stub src/lib.rs and src/main.rs entry
+// points wherever the real crate has them — and the unmodified full source tree. Building
+// the skeleton compiles just the dependency graph, which warmDependencyCache uses to
+// populate the cargo/target caches before the real source is built incrementally.
+func (m *VibeWorkspace) RustSource(ctx context.Context, source *dagger.Directory) (skeleton *dagger.Directory, full *dagger.Directory, err error) {
+	skeleton = dag.Directory().WithFile("Cargo.toml", source.File("Cargo.toml"))
+
+	if lockfiles, err := source.Glob(ctx, "Cargo.lock"); err != nil {
+		return nil, nil, fmt.Errorf("reading workspace manifest: %w", err)
+	} else if len(lockfiles) > 0 {
+		skeleton = skeleton.WithFile("Cargo.lock", source.File("Cargo.lock"))
+	}
+
+	rootStub, err := stubEntryPoints(ctx, source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("stubbing workspace crate: %w", err)
+	}
+	skeleton = skeleton.WithDirectory("src", rootStub)
+
+	members, err := source.Glob(ctx, "*/Cargo.toml")
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing workspace members: %w", err)
+	}
+
+	for _, manifest := range members {
+		memberDir := strings.TrimSuffix(manifest, "/Cargo.toml")
+
+		memberStub, err := stubEntryPoints(ctx, source.Directory(memberDir))
+		if err != nil {
+			return nil, nil, fmt.Errorf("stubbing workspace member %q: %w", memberDir, err)
+		}
+
+		skeleton = skeleton.
+			WithFile(manifest, source.File(manifest)).
+			WithDirectory(memberDir+"/src", memberStub)
+	}
+
+	return skeleton, source, nil
+}
+
+// stubEntryPoints returns a src/ directory with empty stand-ins for whichever of
+// lib.rs/main.rs the real crate has, so cargo only compiles its dependencies against it.
+func stubEntryPoints(ctx context.Context, crate *dagger.Directory) (*dagger.Directory, error) {
+	stub := dag.Directory()
+
+	for _, entry := range []string{"lib.rs", "main.rs"} {
+		matches, err := crate.Glob(ctx, "src/"+entry)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		content := ""
+		if entry == "main.rs" {
+			content = "fn main() {}\n"
+		}
+		stub = stub.WithNewFile(entry, content)
+	}
+
+	return stub, nil
+}
+
 // Helper functions
 
 // rustBase returns a container with Rust toolchain installed
@@ -292,31 +545,162 @@ func (m *VibeWorkspace) rustBaseWithPlatform(source *dagger.Directory, platform
 		WithExec([]string{"rustup", "component", "add", "rustfmt", "clippy"})
 }
 
-// buildEnv returns a container with build dependencies and source code
-func (m *VibeWorkspace) buildEnv(source *dagger.Directory) *dagger.Container {
-	return m.rustBase(source).
-		WithEnvVariable("CARGO_HOME", "/cargo").
-		WithMountedCache("/cargo", dag.CacheVolume("cargo-cache")).
-		WithMountedCache("/src/target", dag.CacheVolume("target-cache"))
+// buildEnv returns a container with build dependencies and source code. The dependency
+// graph is compiled against a skeleton of the source first (see RustSource) so that
+// editing application code doesn't bust the dependency-compile cache layer.
+func (m *VibeWorkspace) buildEnv(ctx context.Context, source *dagger.Directory, profile string, useMold bool, useSccache bool) (*dagger.Container, error) {
+	ctr, err := m.warmDependencyCache(ctx, dag.Container().From("rust:1.88.0"), source, profile, "")
+	if err != nil {
+		return nil, err
+	}
+
+	ctr = ctr.WithExec([]string{"rustup", "component", "add", "rustfmt", "clippy"})
+
+	return m.withAcceleration(ctr, "x86_64-unknown-linux-gnu", useMold, useSccache, nil), nil
 }
 
 // buildEnvWithPlatform returns a container with build dependencies for a specific platform
-func (m *VibeWorkspace) buildEnvWithPlatform(source *dagger.Directory, platform string) *dagger.Container {
-	return m.rustBaseWithPlatform(source, platform).
-		WithEnvVariable("CARGO_HOME", "/cargo").
-		WithMountedCache("/cargo", dag.CacheVolume("cargo-cache")).
-		WithMountedCache("/src/target", dag.CacheVolume("target-cache"))
+func (m *VibeWorkspace) buildEnvWithPlatform(ctx context.Context, source *dagger.Directory, platform string, profile string, useMold bool, useSccache bool) (*dagger.Container, error) {
+	base := dag.Container(dagger.ContainerOpts{Platform: dagger.Platform(platform)}).From("rust:1.88.0")
+
+	ctr, err := m.warmDependencyCache(ctx, base, source, profile, "")
+	if err != nil {
+		return nil, err
+	}
+
+	ctr = ctr.WithExec([]string{"rustup", "component", "add", "rustfmt", "clippy"})
+
+	return m.withAcceleration(ctr, platformTriple(platform), useMold, useSccache, nil), nil
 }
 
-// zigbuildBase returns a container with cargo-zigbuild installed
-func (m *VibeWorkspace) zigbuildBase(source *dagger.Directory) *dagger.Container {
-	return dag.Container().
-		From("ghcr.io/rust-cross/cargo-zigbuild:latest").
-		WithDirectory("/src", source).
-		WithWorkdir("/src").
+// zigbuildBase returns a container with cargo-zigbuild installed, targeting the given Rust triple
+func (m *VibeWorkspace) zigbuildBase(ctx context.Context, source *dagger.Directory, target string, useMold bool, useSccache bool) (*dagger.Container, error) {
+	t := m.targetFor(target)
+
+	// The rustup target (and any extra components it needs) must be installed before
+	// warmDependencyCache runs its skeleton build, since that build already cross-compiles
+	// with --target and fails if the std-lib for target isn't installed yet.
+	// rustup has no universal2 target; cargo-zigbuild builds it from both macOS targets.
+	rustupTargets := []string{target}
+	if target == "universal2-apple-darwin" {
+		rustupTargets = []string{"x86_64-apple-darwin", "aarch64-apple-darwin"}
+	}
+	base := dag.Container().From("ghcr.io/rust-cross/cargo-zigbuild:latest").
+		WithExec(append([]string{"rustup", "target", "add"}, rustupTargets...))
+	for _, component := range t.ExtraSetup {
+		base = base.WithExec([]string{"rustup", "component", "add", component})
+	}
+
+	// ZigbuildSingle always builds --release, so the skeleton warm-up matches it.
+	ctr, err := m.warmDependencyCache(ctx, base, source, "release", target)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.withAcceleration(ctr, target, useMold, useSccache, t.RustFlags), nil
+}
+
+// warmDependencyCache mounts the cargo/target caches on base, compiles the dependency
+// graph against RustSource's skeleton to populate them, then overlays the real source.
+// Because Dagger caches container layers by input hash, the skeleton-build layer is
+// unaffected by later edits to application .rs files, so it keeps getting reused.
+//
+// profile ("debug" or "release") and target (a Rust triple, or "" for a native
+// cargo build) must match whatever command the caller runs against the real source, or
+// the skeleton build populates a target/ subdirectory the real build never looks at.
+func (m *VibeWorkspace) warmDependencyCache(ctx context.Context, base *dagger.Container, source *dagger.Directory, profile string, target string) (*dagger.Container, error) {
+	skeleton, full, err := m.RustSource(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	warmCmd := []string{"cargo"}
+	if target != "" {
+		warmCmd = append(warmCmd, "zigbuild", "--target", target)
+	} else {
+		warmCmd = append(warmCmd, "build")
+	}
+	if profile == "release" {
+		warmCmd = append(warmCmd, "--release")
+	}
+
+	ctr := base.
 		WithEnvVariable("CARGO_HOME", "/cargo").
 		WithMountedCache("/cargo", dag.CacheVolume("cargo-cache")).
-		WithMountedCache("/src/target", dag.CacheVolume("target-cache"))
+		WithMountedCache("/src/target", dag.CacheVolume("target-cache")).
+		WithDirectory("/src", skeleton).
+		WithWorkdir("/src").
+		WithExec(warmCmd).
+		WithDirectory("/src", full)
+
+	return ctr, nil
+}
+
+// platformTriple maps a Dagger platform string to its native Rust target triple
+func platformTriple(platform string) string {
+	switch platform {
+	case "linux/arm64":
+		return "aarch64-unknown-linux-gnu"
+	case "darwin/amd64":
+		return "x86_64-apple-darwin"
+	case "darwin/arm64":
+		return "aarch64-apple-darwin"
+	default:
+		return "x86_64-unknown-linux-gnu"
+	}
+}
+
+// withAcceleration wires sccache and the mold linker into a build container. sccache is
+// cross-platform; mold only links on Linux, so the toggle is a no-op for other triples.
+// extraRustFlags are target-specific flags (e.g. musl's static CRT) that must be combined
+// with, not replace, whatever flags mold needs.
+func (m *VibeWorkspace) withAcceleration(ctr *dagger.Container, triple string, useMold bool, useSccache bool, extraRustFlags []string) *dagger.Container {
+	if useSccache {
+		ctr = m.installSccache(ctr).
+			WithEnvVariable("RUSTC_WRAPPER", "sccache").
+			WithEnvVariable("SCCACHE_DIR", "/sccache").
+			WithMountedCache("/sccache", dag.CacheVolume("sccache"))
+	}
+
+	var rustFlags []string
+	if useMold && strings.Contains(triple, "linux") {
+		ctr = m.installMold(ctr).WithEnvVariable(cargoLinkerEnvVar(triple), "clang")
+		rustFlags = append(rustFlags, "-C", "link-arg=-fuse-ld=mold")
+	}
+	rustFlags = append(rustFlags, extraRustFlags...)
+
+	if len(rustFlags) > 0 {
+		ctr = ctr.WithEnvVariable("RUSTFLAGS", strings.Join(rustFlags, " "))
+	}
+
+	return ctr
+}
+
+// installMold downloads a pinned mold release and installs it into /usr/local/bin, plus
+// clang from apt (required so rustc can drive `-fuse-ld=mold` through a linker front end).
+func (m *VibeWorkspace) installMold(ctr *dagger.Container) *dagger.Container {
+	moldTarball := dag.HTTP(moldReleaseURL)
+	moldDir := fmt.Sprintf("mold-%s-x86_64-linux", moldVersion)
+
+	return ctr.
+		WithExec([]string{"apt-get", "update"}).
+		WithExec([]string{"apt-get", "install", "-y", "--no-install-recommends", "clang"}).
+		WithFile("/tmp/mold.tar.gz", moldTarball).
+		WithExec([]string{"tar", "-xzf", "/tmp/mold.tar.gz", "-C", "/tmp"}).
+		WithExec([]string{"cp", fmt.Sprintf("/tmp/%s/bin/mold", moldDir), "/usr/local/bin/mold"}).
+		WithExec([]string{"rm", "-rf", "/tmp/mold.tar.gz", fmt.Sprintf("/tmp/%s", moldDir)})
+}
+
+// installSccache installs sccache via cargo; the binary is cached alongside the rest of
+// CARGO_HOME in the cargo cache volume.
+func (m *VibeWorkspace) installSccache(ctr *dagger.Container) *dagger.Container {
+	return ctr.WithExec([]string{"cargo", "install", "sccache", "--locked"})
+}
+
+// cargoLinkerEnvVar returns the CARGO_TARGET_<TRIPLE>_LINKER environment variable name
+// cargo reads to pick the linker for a given target triple.
+func cargoLinkerEnvVar(triple string) string {
+	return "CARGO_TARGET_" + strings.ToUpper(strings.ReplaceAll(triple, "-", "_")) + "_LINKER"
 }
 
 // packageTarGz creates a tar.gz archive
@@ -328,7 +712,7 @@ func (m *VibeWorkspace) packageTarGz(
 	version string,
 ) *dagger.File {
 	archiveName := fmt.Sprintf("vibe-workspace-%s-%s.tar.gz", version, platform)
-	
+
 	return dag.Container().
 		From("alpine:latest").
 		WithExec([]string{"apk", "add", "--no-cache", "tar", "gzip"}).
@@ -348,18 +732,14 @@ func (m *VibeWorkspace) packageZip(
 	version string,
 ) *dagger.File {
 	archiveName := fmt.Sprintf("vibe-workspace-%s-%s.zip", version, platform)
-	
+
 	return dag.Container().
 		From("alpine:latest").
 		WithExec([]string{"apk", "add", "--no-cache", "zip"}).
 		WithFile("/tmp/vibe.exe", binary).
 		WithFile("/tmp/README.md", source.File("README.md")).
+		WithFile("/tmp/LICENSE", source.File("LICENSE")).
 		WithWorkdir("/tmp").
-		WithExec([]string{"zip", "-j", archiveName, "vibe.exe", "README.md"}).
+		WithExec([]string{"zip", "-j", archiveName, "vibe.exe", "README.md", "LICENSE"}).
 		File(archiveName)
 }
-
-// contains checks if a string contains a substring
-func contains(s, substr string) bool {
-	return len(s) > 0 && len(substr) > 0 && (s == substr || len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr || substr != s && contains(s[1:], substr)))
-}
\ No newline at end of file
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"dagger/vibe-workspace/internal/dagger"
+)
+
+// Step is one node of the build graph, in the spirit of rustc's bootstrap Step trait:
+// each step declares what it depends on and how to produce its Artifact, and the
+// Builder takes care of running dependencies first and reusing already-built output.
+type Step interface {
+	// Name uniquely identifies this step and its inputs; combined with a hash of the
+	// source tree, it is the Builder's cache key.
+	Name() string
+	Depends() []Step
+	Run(ctx context.Context, b *Builder) (Artifact, error)
+}
+
+// Artifact is whatever a Step produces. Exactly one field is populated, matching the
+// dagger.Container/File/Directory return types our public API already exposes.
+type Artifact struct {
+	Container *dagger.Container
+	File      *dagger.File
+	Directory *dagger.Directory
+}
+
+// stepCache memoizes Artifacts by (source content hash, Step.Name()) across every
+// Builder in this module process, so entrypoints that run the same step over the same
+// source tree reuse its artifact instead of each re-running cargo from a private,
+// per-call cache — while two Builders over different source trees never read back each
+// other's artifacts. CI and Release run no step in common (CI's TestStep is a debug test
+// run; Release's BuildSteps are release builds), so they do not share artifacts.
+var stepCache = struct {
+	mu sync.Mutex
+	m  map[string]Artifact
+}{m: make(map[string]Artifact)}
+
+// Builder runs Steps against a single invocation's source tree, consulting and
+// populating the shared stepCache as it goes.
+type Builder struct {
+	vw        *VibeWorkspace
+	source    *dagger.Directory
+	sourceKey string
+}
+
+// NewBuilder creates a Builder for a single invocation's source tree.
+func NewBuilder(vw *VibeWorkspace, source *dagger.Directory) *Builder {
+	return &Builder{vw: vw, source: source}
+}
+
+// cacheKey combines step.Name() with a content hash of b.source, so Builders over
+// different source trees (e.g. back-to-back invocations in the same module process)
+// never read back each other's cached artifacts.
+func (b *Builder) cacheKey(ctx context.Context, step Step) (string, error) {
+	if b.sourceKey == "" {
+		id, err := b.source.ID(ctx)
+		if err != nil {
+			return "", fmt.Errorf("hashing source for step cache: %w", err)
+		}
+		b.sourceKey = string(id)
+	}
+	return b.sourceKey + ":" + step.Name(), nil
+}
+
+// cached looks up a memoized Artifact for step, scoped to b.source.
+func (b *Builder) cached(ctx context.Context, step Step) (Artifact, bool, error) {
+	key, err := b.cacheKey(ctx, step)
+	if err != nil {
+		return Artifact{}, false, err
+	}
+	stepCache.mu.Lock()
+	defer stepCache.mu.Unlock()
+	a, ok := stepCache.m[key]
+	return a, ok, nil
+}
+
+// runStep runs a step's dependencies, then the step itself, caching the result.
+func (b *Builder) runStep(ctx context.Context, step Step) (Artifact, error) {
+	if a, ok, err := b.cached(ctx, step); err != nil {
+		return Artifact{}, err
+	} else if ok {
+		return a, nil
+	}
+
+	for _, dep := range step.Depends() {
+		if _, err := b.runStep(ctx, dep); err != nil {
+			return Artifact{}, fmt.Errorf("step %q: dependency %q: %w", step.Name(), dep.Name(), err)
+		}
+	}
+
+	a, err := step.Run(ctx, b)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("step %q: %w", step.Name(), err)
+	}
+
+	key, err := b.cacheKey(ctx, step)
+	if err != nil {
+		return Artifact{}, err
+	}
+	stepCache.mu.Lock()
+	stepCache.m[key] = a
+	stepCache.mu.Unlock()
+	return a, nil
+}
+
+// FormatStep checks `cargo fmt --check`.
+type FormatStep struct{}
+
+func (FormatStep) Name() string    { return "format" }
+func (FormatStep) Depends() []Step { return nil }
+func (FormatStep) Run(ctx context.Context, b *Builder) (Artifact, error) {
+	ctr := b.vw.rustBase(b.source).
+		WithExec([]string{"cargo", "fmt", "--check"})
+	return Artifact{Container: ctr}, nil
+}
+
+// LintStep runs clippy.
+type LintStep struct{}
+
+func (LintStep) Name() string    { return "lint" }
+func (LintStep) Depends() []Step { return nil }
+func (LintStep) Run(ctx context.Context, b *Builder) (Artifact, error) {
+	ctr, err := b.vw.buildEnv(ctx, b.source, "debug", true, true)
+	if err != nil {
+		return Artifact{}, err
+	}
+	ctr = ctr.WithExec([]string{"cargo", "clippy", "--all-targets", "--all-features"})
+	return Artifact{Container: ctr}, nil
+}
+
+// TestStep runs the test suite for a platform.
+type TestStep struct {
+	Platform   string
+	UseMold    bool
+	UseSccache bool
+}
+
+func (s TestStep) Name() string {
+	return fmt.Sprintf("test:%s:mold=%v:sccache=%v", s.Platform, s.UseMold, s.UseSccache)
+}
+func (s TestStep) Depends() []Step { return nil }
+func (s TestStep) Run(ctx context.Context, b *Builder) (Artifact, error) {
+	ctr, err := b.vw.buildEnvWithPlatform(ctx, b.source, s.Platform, "debug", s.UseMold, s.UseSccache)
+	if err != nil {
+		return Artifact{}, err
+	}
+	ctr = ctr.WithExec([]string{"cargo", "test"})
+	return Artifact{Container: ctr}, nil
+}
+
+// BuildStep compiles the `vibe` binary for a platform at a given profile ("debug" or
+// "release").
+type BuildStep struct {
+	Profile    string
+	Platform   string
+	UseMold    bool
+	UseSccache bool
+}
+
+func (s BuildStep) Name() string {
+	return fmt.Sprintf("build:%s:%s:mold=%v:sccache=%v", s.Profile, s.Platform, s.UseMold, s.UseSccache)
+}
+func (s BuildStep) Depends() []Step { return nil }
+func (s BuildStep) Run(ctx context.Context, b *Builder) (Artifact, error) {
+	base, err := b.vw.buildEnvWithPlatform(ctx, b.source, s.Platform, s.Profile, s.UseMold, s.UseSccache)
+	if err != nil {
+		return Artifact{}, err
+	}
+	name := "vibe"
+
+	args := []string{"cargo", "build", "--bin", name}
+	path := fmt.Sprintf("/src/target/debug/%s", name)
+	if s.Profile == "release" {
+		args = []string{"cargo", "build", "--release", "--bin", name}
+		path = fmt.Sprintf("/src/target/release/%s", name)
+	}
+
+	file := base.WithExec(args).File(path)
+	return Artifact{File: file}, nil
+}
+
+// PackageStep archives a release binary built by BuildStep for the given platform.
+// Triple labels the archive (e.g. "x86_64-unknown-linux-gnu"); Format is "tar.gz" or
+// "zip".
+type PackageStep struct {
+	Platform string
+	Triple   string
+	Version  string
+	Format   string
+}
+
+func (s PackageStep) Name() string {
+	return "package:" + s.Format + ":" + s.Platform + ":" + s.Triple + ":" + s.Version
+}
+
+func (s PackageStep) Depends() []Step {
+	return []Step{BuildStep{Profile: "release", Platform: s.Platform, UseMold: true, UseSccache: true}}
+}
+
+func (s PackageStep) Run(ctx context.Context, b *Builder) (Artifact, error) {
+	buildStep := BuildStep{Profile: "release", Platform: s.Platform, UseMold: true, UseSccache: true}
+	build, ok, err := b.cached(ctx, buildStep)
+	if err != nil {
+		return Artifact{}, err
+	}
+	if !ok || build.File == nil {
+		return Artifact{}, fmt.Errorf("build artifact for platform %q not found", s.Platform)
+	}
+
+	var file *dagger.File
+	if s.Format == "zip" {
+		file = b.vw.packageZip(ctx, b.source, build.File, s.Triple, s.Version)
+	} else {
+		file = b.vw.packageTarGz(ctx, b.source, build.File, s.Triple, s.Version)
+	}
+	return Artifact{File: file}, nil
+}
+
+// ReleaseTarget pairs the Dagger platform a binary is built on with the Rust target
+// triple its archive is labeled with.
+type ReleaseTarget struct {
+	Platform string
+	Triple   string
+}
+
+// ReleaseStep packages release archives for a set of targets into one output directory.
+type ReleaseStep struct {
+	Targets []ReleaseTarget
+	Version string
+}
+
+func (s ReleaseStep) Name() string {
+	key := "release:" + s.Version
+	for _, t := range s.Targets {
+		key += ":" + t.Platform + "=" + t.Triple
+	}
+	return key
+}
+
+func (s ReleaseStep) Depends() []Step {
+	deps := make([]Step, 0, len(s.Targets))
+	for _, t := range s.Targets {
+		deps = append(deps, PackageStep{Platform: t.Platform, Triple: t.Triple, Version: s.Version, Format: "tar.gz"})
+	}
+	return deps
+}
+
+func (s ReleaseStep) Run(ctx context.Context, b *Builder) (Artifact, error) {
+	output := dag.Directory()
+	for _, t := range s.Targets {
+		pkg := PackageStep{Platform: t.Platform, Triple: t.Triple, Version: s.Version, Format: "tar.gz"}
+		a, ok, err := b.cached(ctx, pkg)
+		if err != nil {
+			return Artifact{}, err
+		}
+		if !ok || a.File == nil {
+			return Artifact{}, fmt.Errorf("package artifact for triple %q not found", t.Triple)
+		}
+		archiveName := fmt.Sprintf("vibe-workspace-%s-%s.tar.gz", s.Version, t.Triple)
+		output = output.WithFile(archiveName, a.File)
+	}
+	return Artifact{Directory: output}, nil
+}
+
+// Run invokes a single named Step against source, letting callers drive the build graph
+// directly from the Dagger CLI (e.g. `dagger call run --step=build --profile=release`)
+// instead of going through one of the fixed top-level functions. Only the parameters
+// relevant to the chosen step are consulted; the rest are ignored.
+func (m *VibeWorkspace) Run(
+	ctx context.Context,
+	source *dagger.Directory,
+	step string,
+	// +optional
+	// +default="linux/amd64"
+	platform string,
+	// +optional
+	// +default="debug"
+	profile string,
+	// +optional
+	// +default="x86_64-unknown-linux-gnu"
+	triple string,
+	// +optional
+	// +default="v0.1.0"
+	version string,
+	// +optional
+	// +default="tar.gz"
+	format string,
+	// +optional
+	// +default=true
+	useMold bool,
+	// +optional
+	// +default=true
+	useSccache bool,
+) (Artifact, error) {
+	s, err := resolveStep(step, platform, profile, triple, version, format, useMold, useSccache)
+	if err != nil {
+		return Artifact{}, err
+	}
+	b := NewBuilder(m, source)
+	return b.runStep(ctx, s)
+}
+
+// resolveStep turns a step name and its typed arguments into a concrete Step.
+func resolveStep(step, platform, profile, triple, version, format string, useMold, useSccache bool) (Step, error) {
+	switch step {
+	case "format":
+		return FormatStep{}, nil
+	case "lint":
+		return LintStep{}, nil
+	case "test":
+		return TestStep{Platform: platform, UseMold: useMold, UseSccache: useSccache}, nil
+	case "build":
+		return BuildStep{Profile: profile, Platform: platform, UseMold: useMold, UseSccache: useSccache}, nil
+	case "package":
+		return PackageStep{Platform: platform, Triple: triple, Version: version, Format: format}, nil
+	case "release":
+		return ReleaseStep{Targets: defaultReleaseTargets(), Version: version}, nil
+	default:
+		return nil, fmt.Errorf("unknown step %q", step)
+	}
+}
+
+func defaultReleaseTargets() []ReleaseTarget {
+	return []ReleaseTarget{
+		{Platform: "linux/amd64", Triple: "x86_64-unknown-linux-gnu"},
+		{Platform: "linux/arm64", Triple: "aarch64-unknown-linux-gnu"},
+	}
+}